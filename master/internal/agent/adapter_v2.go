@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/determined-ai/determined/master/internal/mesh"
+	"github.com/determined-ai/determined/master/pkg/actor"
+	ws "github.com/determined-ai/determined/master/pkg/actor/api"
+	aproto "github.com/determined-ai/determined/master/pkg/agent"
+	"github.com/determined-ai/determined/master/pkg/container"
+	"github.com/determined-ai/determined/proto/pkg/agentv2"
+)
+
+// registerV2Adapter is told to the agent actor once a v2 agent has
+// registered and dialed back, so that Receive (the only place that may
+// mutate agent state) can record the adapter and switch the actor's send
+// path over to it. dialAddr and nodeKey carry what WebSocketConnected would
+// otherwise have read off the HTTP request, so the registerV2Adapter case
+// can run the same address/mesh-join initialization v1 does.
+type registerV2Adapter struct {
+	adapter  *v2Adapter
+	dialAddr string
+	nodeKey  mesh.NodeKey
+}
+
+// v2Adapter sits between a v2 AgentService stream and an agent actor,
+// translating gRPC RPCs into the same aproto message types the v1 websocket
+// path produces, so both protocol versions drive the identical Receive
+// loop. It is created by the gRPC server once a v2 agent has registered.
+//
+// Unlike v1, where the master can only write to the connection the agent
+// opened, a v2 agent also runs a small AgentService server of its own,
+// reachable at its overlay mesh address; the master dials it directly to
+// push StartContainer/SignalContainer, the master-to-agent half of the
+// protocol that StreamContainerEvents (agent-to-master) does not carry.
+type v2Adapter struct {
+	agent  *actor.Ref
+	stream agentv2.AgentService_StreamContainerEventsServer
+	client agentv2.AgentServiceClient
+}
+
+// newV2Adapter dials the registering agent back at dialAddr (its overlay
+// address), registers it with agentRef, and returns an adapter that routes
+// both directions of traffic in place of the websocket used by v1.
+func newV2Adapter(
+	agentRef *actor.Ref,
+	stream agentv2.AgentService_StreamContainerEventsServer,
+	reg *agentv2.RegisterRequest,
+	dialAddr string,
+) (*v2Adapter, error) {
+	conn, err := grpc.Dial(dialAddr, grpc.WithInsecure()) //nolint:staticcheck
+	if err != nil {
+		return nil, err
+	}
+
+	v := &v2Adapter{agent: agentRef, stream: stream, client: agentv2.NewAgentServiceClient(conn)}
+	agentRef.System().Tell(agentRef, registerV2Adapter{
+		adapter:  v,
+		dialAddr: dialAddr,
+		nodeKey:  mesh.NodeKey(reg.NodeKey),
+	})
+	agentRef.System().Tell(agentRef, aproto.MasterMessage{
+		AgentStarted: &aproto.AgentStarted{
+			AgentID:      reg.AgentId,
+			SessionToken: reg.SessionToken,
+			Capabilities: capabilityNames(reg.Capabilities),
+		},
+	})
+	return v, nil
+}
+
+// capabilityName maps a negotiated agentv2.Capability enum value to the
+// capability string negotiateCapabilities expects, e.g.
+// CAPABILITY_SUPPORTS_REATTACH -> "SUPPORTS_REATTACH". protoc-gen-go's
+// generated String() returns the full enum name including the
+// "CAPABILITY_" prefix, which would never match protocol.go's constants
+// (defined without that prefix, to stay renderable in both the v1 and v2
+// handshakes) and so would silently negotiate every v2 agent down to no
+// capabilities at all.
+func capabilityName(c agentv2.Capability) string {
+	return strings.TrimPrefix(c.String(), "CAPABILITY_")
+}
+
+// run drains the agent's event stream until it closes or errors, forwarding
+// each ContainerEvent to the agent actor as an aproto.ContainerStateChanged,
+// exactly as handleIncomingWSMessage does for v1.
+func (v *v2Adapter) run() error {
+	for {
+		ev, err := v.stream.Recv()
+		switch {
+		case err == io.EOF:
+			v.agent.System().Tell(v.agent, ws.WebSocketDisconnected{})
+			return nil
+		case err != nil:
+			return err
+		}
+		sc := aproto.ContainerStateChanged{
+			Container: container.Container{
+				ID:    container.ID(ev.ContainerId),
+				State: container.State(ev.State),
+			},
+		}
+		// containerStateChanged's Running branch unconditionally reads
+		// sc.ContainerStarted.ProxyAddress, so ContainerStarted must be
+		// non-nil here even though v2's ContainerEvent only populates
+		// ProxyAddress on the transition into Running.
+		if sc.Container.State == container.Running {
+			sc.ContainerStarted = &aproto.ContainerStarted{ProxyAddress: ev.ProxyAddress}
+		}
+		v.agent.System().Tell(v.agent, aproto.MasterMessage{ContainerStateChanged: &sc})
+	}
+}
+
+// runLogs drains the agent's log stream until it closes or errors, the v2
+// counterpart of run() for StreamLogs: it forwards each LogRecord to the
+// agent actor as an aproto.ContainerLog, exactly as handleIncomingWSMessage
+// does with a v1 agent's ContainerLog message.
+func (v *v2Adapter) runLogs(stream agentv2.AgentService_StreamLogsServer) error {
+	for {
+		rec, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		runMessage := string(rec.Message)
+		v.agent.System().Tell(v.agent, aproto.MasterMessage{
+			ContainerLog: &aproto.ContainerLog{
+				Container:  container.Container{ID: container.ID(rec.ContainerId)},
+				Timestamp:  time.Now(),
+				RunMessage: &runMessage,
+			},
+		})
+	}
+}
+
+// startContainer is the v2 equivalent of v1's ws.WriteMessage{StartContainer}.
+func (v *v2Adapter) startContainer(ctx context.Context, containerID container.ID, spec []byte) error {
+	_, err := v.client.StartContainer(ctx, &agentv2.StartContainerRequest{
+		ContainerId: string(containerID),
+		Spec:        spec,
+	})
+	return err
+}
+
+// signalContainer is the v2 equivalent of v1's ws.WriteMessage{SignalContainer}.
+func (v *v2Adapter) signalContainer(
+	ctx context.Context, containerID container.ID, signal aproto.SignalContainer,
+) error {
+	_, err := v.client.SignalContainer(ctx, &agentv2.SignalContainerRequest{
+		ContainerId: string(containerID),
+		Signal:      signal.Signal.String(),
+	})
+	return err
+}
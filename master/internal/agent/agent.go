@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"net/http"
 	"sort"
 	"strings"
@@ -9,38 +10,98 @@ import (
 	"github.com/google/uuid"
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
+	"github.com/determined-ai/determined/master/internal/cluster"
+	"github.com/determined-ai/determined/master/internal/mesh"
 	"github.com/determined-ai/determined/master/internal/sproto"
 	"github.com/determined-ai/determined/master/internal/telemetry"
 	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/master/pkg/actor/actors"
 	ws "github.com/determined-ai/determined/master/pkg/actor/api"
 	aproto "github.com/determined-ai/determined/master/pkg/agent"
+	"github.com/determined-ai/determined/master/pkg/alerting"
 	"github.com/determined-ai/determined/master/pkg/check"
+	"github.com/determined-ai/determined/master/pkg/constraint"
 	"github.com/determined-ai/determined/master/pkg/container"
 	"github.com/determined-ai/determined/proto/pkg/agentv1"
 	proto "github.com/determined-ai/determined/proto/pkg/apiv1"
 )
 
+// defaultReconnectTimeout is how long an agent actor is kept alive after its
+// websocket drops, waiting for the same physical agent to reattach, when the
+// agent config does not specify one.
+const defaultReconnectTimeout = 30 * time.Second
+
+// reconnectTimeoutExpired is sent to the agent actor after reconnectTimeout
+// elapses with no reattach; it triggers the existing agent-failed path.
+type reconnectTimeoutExpired struct{}
+
 type agent struct {
 	address    string
 	cluster    *actor.Ref
 	socket     *actor.Ref
 	slots      *actor.Ref
 	containers map[container.ID]*actor.Ref
-	label      string
+
+	// labels are arbitrary operator-defined key/value pairs reported by
+	// the agent on AgentStarted and mutable at runtime via
+	// UpdateAgentLabelsRequest. constraints are agent-reported facts
+	// (kernel version, CUDA version, hostname, zone, ...) the scheduler
+	// matches task placement constraints against; unlike labels they are
+	// not operator-mutable.
+	labels      map[string]string
+	constraints map[string]string
+
+	// mesh is the overlay-network coordinator actor; overlayAddress is the
+	// address it assigned this agent, used as ProxyAddress in place of the
+	// raw underlay address so containers stay reachable across NAT/VPC/
+	// Kubernetes-overlay boundaries.
+	mesh           *actor.Ref
+	overlayAddress string
 
 	// uuid is an anonymous ID that is used when reporting telemetry
 	// information to allow agent connection and disconnection events
 	// to be correlated.
 	uuid uuid.UUID
+
+	// agentID and sessionToken identify the physical agent independent of
+	// its actor address or websocket connection, so that a reconnecting
+	// agent can be recognized as the same agent rather than a new one.
+	agentID      string
+	sessionToken string
+
+	// protocolVersion is "v1" for agents connected over the legacy
+	// websocket framing and "v2" for agents connected through the
+	// streaming adapter (set by registerV2Adapter); it is informational
+	// only, since both are driven through the same Receive loop once
+	// routed through an adapter.
+	protocolVersion string
+	capabilities    capabilitySet
+
+	// v2 is non-nil once a v2 agent has registered; it replaces socket as
+	// the send path for StartContainer/SignalContainer/WritePrepared.
+	v2 *v2Adapter
+
+	// reconnectTimeout is how long to keep this actor and its containers
+	// map alive after the websocket disconnects before falling back to
+	// treating the agent as failed. Zero means defaultReconnectTimeout.
+	reconnectTimeout time.Duration
+
+	// awaitingReconnect is true while we are inside the reconnection
+	// window: the websocket is down but containers have not yet been
+	// failed, and we are waiting for an AgentReattached message.
+	awaitingReconnect bool
+	reconnectTimer    *actor.Ref
 }
 
 type agentSummary struct {
-	ID             string       `json:"id"`
-	RegisteredTime time.Time    `json:"registered_time"`
-	Slots          slotsSummary `json:"slots"`
-	NumContainers  int          `json:"num_containers"`
-	Label          string       `json:"label"`
+	ID             string            `json:"id"`
+	RegisteredTime time.Time         `json:"registered_time"`
+	Slots          slotsSummary      `json:"slots"`
+	NumContainers  int               `json:"num_containers"`
+	Labels         map[string]string `json:"labels"`
+	Constraints    map[string]string `json:"constraints"`
 }
 
 func (a *agent) Receive(ctx *actor.Context) error {
@@ -56,17 +117,114 @@ func (a *agent) Receive(ctx *actor.Context) error {
 		socket, ok := msg.Accept(ctx, aproto.MasterMessage{}, true)
 		check.Panic(check.True(ok, "failed to accept websocket connection"))
 		a.socket = socket
-		lastColonIndex := strings.LastIndex(msg.Ctx.Request().RemoteAddr, ":")
-		if lastColonIndex == -1 {
-			a.address = msg.Ctx.Request().RemoteAddr
-		} else {
-			a.address = msg.Ctx.Request().RemoteAddr[0:lastColonIndex]
+		a.protocolVersion = "v1"
+		ctx.Tell(a.cluster, cluster.SetAgentProtocolVersion{Agent: ctx.Self(), ProtocolVersion: a.protocolVersion})
+		a.address = hostOnly(msg.Ctx.Request().RemoteAddr)
+		a.joinMesh(ctx, mesh.NodeKey(msg.Ctx.Request().Header.Get("X-Determined-Node-Key")))
+		// Deliberately not clearing awaitingReconnect or the reconnect timer
+		// here: a bare socket reconnect only proves the transport is back,
+		// not that this is the same agent resuming the same session. The
+		// timer stays armed, and awaitingReconnect stays true, until
+		// reconcileReattach actually processes an AgentReattached message —
+		// otherwise a client that reconnects but never reattaches (dropped
+		// message, buggy agent) would disarm its only failure-detection
+		// timeout and its containers would stay stuck in Disconnected
+		// forever.
+	case ws.WebSocketDisconnected:
+		a.socket = nil
+		alerting.Emit(alerting.AgentDisconnected{AgentID: a.agentID, Labels: a.labels})
+		if !a.capabilities.has(capabilitySupportsReattach) {
+			return errors.New("agent does not support reattach; treating disconnect as failure")
+		}
+		a.awaitingReconnect = true
+		timeout := a.reconnectTimeout
+		if timeout == 0 {
+			timeout = defaultReconnectTimeout
+		}
+		a.reconnectTimer = actors.NotifyAfter(ctx, timeout, reconnectTimeoutExpired{})
+		for cid, task := range a.containers {
+			ctx.Tell(task, sproto.ContainerStateChanged{
+				Container: container.Container{ID: cid, State: container.Disconnected},
+			})
+		}
+	case reconnectTimeoutExpired:
+		if a.awaitingReconnect {
+			return errors.New("agent did not reattach within the reconnection window")
 		}
+	case registerV2Adapter:
+		a.protocolVersion = "v2"
+		ctx.Tell(a.cluster, cluster.SetAgentProtocolVersion{Agent: ctx.Self(), ProtocolVersion: a.protocolVersion})
+		a.v2 = msg.adapter
+		// v1 gets address/mesh-join initialization from WebSocketConnected,
+		// which has an echo.Context to read the remote address and node-key
+		// header off of; v2 has neither, so newV2Adapter carries the same
+		// information (the address it dialed the agent back on, and the
+		// node key from RegisterRequest) for this case to use instead.
+		a.address = hostOnly(msg.dialAddr)
+		a.joinMesh(ctx, msg.nodeKey)
 	case aproto.SignalContainer:
-		ctx.Ask(a.socket, ws.WriteMessage{Message: aproto.AgentMessage{SignalContainer: &msg}})
+		if a.v2 != nil {
+			if err := a.v2.signalContainer(context.Background(), msg.ContainerID, msg); err != nil {
+				logrus.WithError(err).Error("signaling container over v2 protocol")
+			}
+		} else {
+			ctx.Ask(a.socket, ws.WriteMessage{Message: aproto.AgentMessage{SignalContainer: &msg}})
+		}
+	case ws.WritePrepared:
+		// Pre-encoded by cluster.BroadcastSignal for the v1 websocket wire
+		// format; v2 agents use typed unary RPCs instead, so there is
+		// nothing to pre-encode for them. cluster.BroadcastSignal filters
+		// v2 agents out of its Targets, but that's a routing optimization,
+		// not a safety net this case should depend on: a stray
+		// WritePrepared reaching a v2 agent is a message-routing mismatch,
+		// not a reason to fail the agent actor and take down every other
+		// container running on it, so this logs and ignores rather than
+		// returning an error.
+		if a.v2 != nil {
+			logrus.Warn("received WritePrepared for a v2 agent; ignoring")
+			return nil
+		}
+		ctx.Tell(a.socket, msg)
 	case sproto.StartTaskOnAgent:
-		start := ws.WriteMessage{Message: aproto.AgentMessage{StartContainer: &msg.StartContainer}}
-		ctx.Ask(a.socket, start)
+		// The scheduler is expected to have already matched this task's
+		// placement constraint against the agent's advertised facts before
+		// choosing it; this is a defense-in-depth re-check against the
+		// agent's current facts, which may have drifted (labels can change
+		// at runtime) since the scheduler made its decision. A violation
+		// here rejects only this one task: returning an error from Receive
+		// would fail the whole agent actor, whose PostStop then marks
+		// every other currently-running container on this agent as failed
+		// too, which is not warranted by one task's placement drifting.
+		//
+		// Matching at actual placement time — choosing which agent to send
+		// a task to in the first place, rather than re-validating the
+		// choice afterward — belongs in the resource pool that calls
+		// StartTaskOnAgent, which is outside this repository snapshot (no
+		// scheduler/resource-pool package exists here to extend). What this
+		// series does provide for such a component to use is
+		// constraint.Satisfies (also used below) and cluster.MatchingAgents,
+		// the cluster-wide candidate query DrainAgents also uses; nothing
+		// in-tree calls MatchingAgents for placement yet, only for draining.
+		if msg.Constraint != "" {
+			if err := a.checkConstraint(msg.Constraint); err != nil {
+				stopped := aproto.ContainerError(aproto.ConstraintViolation, err)
+				ctx.Tell(msg.Task, sproto.ContainerStateChanged{
+					Container:        container.Container{ID: msg.Container.ID, State: container.Terminated},
+					ContainerStopped: &stopped,
+				})
+				return nil
+			}
+		}
+		if a.v2 != nil {
+			if err := a.v2.startContainer(
+				context.Background(), msg.Container.ID, msg.StartContainer.Spec,
+			); err != nil {
+				logrus.WithError(err).Error("starting container over v2 protocol")
+			}
+		} else {
+			start := ws.WriteMessage{Message: aproto.AgentMessage{StartContainer: &msg.StartContainer}}
+			ctx.Ask(a.socket, start)
+		}
 		ctx.Tell(a.slots, msg.StartContainer)
 		a.containers[msg.Container.ID] = msg.Task
 	case aproto.MasterMessage:
@@ -86,10 +244,23 @@ func (a *agent) Receive(ctx *actor.Context) error {
 	case *proto.DisableAgentRequest:
 		ctx.Tell(a.slots, patchSlot{Enabled: false})
 		ctx.Respond(&proto.DisableAgentResponse{Agent: toProtoAgent(a.summarize(ctx))})
+	case cluster.SetAgentEnabled:
+		// The cluster-wide, selector-addressed counterpart of
+		// EnableAgentRequest/DisableAgentRequest above: cluster.DrainAgents
+		// tells every agent it matched this instead of the caller having to
+		// target agents one ID at a time.
+		ctx.Tell(a.slots, patchSlot{Enabled: msg.Enabled})
+	case *proto.UpdateAgentLabelsRequest:
+		a.labels = msg.Labels
+		ctx.Tell(a.cluster, sproto.UpdateAgentLabels{Agent: ctx.Self(), Labels: a.labels})
+		ctx.Respond(&proto.UpdateAgentLabelsResponse{Agent: toProtoAgent(a.summarize(ctx))})
 	case echo.Context:
 		a.handleAPIRequest(ctx, msg)
 	case actor.ChildFailed:
 		telemetry.ReportAgentDisconnected(ctx.Self().System(), a.uuid)
+		alerting.Emit(alerting.AgentDegraded{
+			AgentID: a.agentID, Labels: a.labels, Reason: msg.Error.Error(),
+		})
 
 		return errors.Wrapf(msg.Error, "child failed: %s", msg.Child.Address())
 	case actor.PostStop:
@@ -105,6 +276,9 @@ func (a *agent) Receive(ctx *actor.Context) error {
 			})
 		}
 		ctx.Tell(a.cluster, sproto.RemoveAgent{Agent: ctx.Self()})
+		if a.mesh != nil {
+			ctx.Tell(a.mesh, mesh.Leave{PeerID: ctx.Self().Address().Local()})
+		}
 	default:
 		return actor.ErrUnexpectedMessage(ctx)
 	}
@@ -125,9 +299,23 @@ func (a *agent) handleIncomingWSMessage(ctx *actor.Context, msg aproto.MasterMes
 	case msg.AgentStarted != nil:
 		telemetry.ReportAgentConnected(ctx.Self().System(), a.uuid, msg.AgentStarted.Devices)
 
-		ctx.Tell(a.cluster, sproto.AddAgent{Agent: ctx.Self(), Label: msg.AgentStarted.Label})
+		a.labels = msg.AgentStarted.Labels
+		a.constraints = msg.AgentStarted.Constraints
+		a.agentID = msg.AgentStarted.AgentID
+		a.sessionToken = msg.AgentStarted.SessionToken
+		a.capabilities = negotiateCapabilities(msg.AgentStarted.Capabilities)
+		// ReconnectTimeout comes from the agent's own config (e.g.
+		// `agent.reconnect_timeout: 2m`), so the window is configurable per
+		// agent rather than hardcoded; zero keeps defaultReconnectTimeout.
+		a.reconnectTimeout = msg.AgentStarted.ReconnectTimeout
+
+		alerting.Emit(alerting.AgentConnected{AgentID: a.agentID, Labels: a.labels})
+		ctx.Tell(a.cluster, sproto.AddAgent{
+			Agent: ctx.Self(), Labels: a.labels, Constraints: a.constraints,
+		})
 		ctx.Tell(a.slots, *msg.AgentStarted)
-		a.label = msg.AgentStarted.Label
+	case msg.AgentReattached != nil:
+		a.reconcileReattach(ctx, *msg.AgentReattached)
 	case msg.ContainerStateChanged != nil:
 		a.containerStateChanged(ctx, *msg.ContainerStateChanged)
 	case msg.ContainerLog != nil:
@@ -149,10 +337,35 @@ func (a *agent) handleIncomingWSMessage(ctx *actor.Context, msg aproto.MasterMes
 func (a *agent) containerStateChanged(ctx *actor.Context, sc aproto.ContainerStateChanged) {
 	task, ok := a.containers[sc.Container.ID]
 	check.Panic(check.True(ok, "container not assigned to agent: container %s", sc.Container.ID))
+
+	// A RUNNING transition always carries ContainerStarted on a live
+	// ContainerStateChanged, but this is also reached from
+	// reconcileReattach replaying a reconnecting agent's self-reported
+	// AgentReattached.Containers, which is wire data from the agent, not
+	// something the master itself constructed. Trusting that invariant by
+	// comment rather than enforcing it would let a buggy, outdated, or
+	// malicious agent nil-deref ProxyAddress below and take down this
+	// actor, failing every other container it is running; treat a RUNNING
+	// report without ContainerStarted as that one container failing
+	// instead.
+	if sc.Container.State == container.Running && sc.ContainerStarted == nil {
+		logrus.Errorf(
+			"agent reported container %s RUNNING without ContainerStarted; treating it as failed",
+			sc.Container.ID)
+		stopped := aproto.ContainerError(
+			aproto.AgentFailed, errors.New("RUNNING reported without ContainerStarted"))
+		sc.Container.State = container.Terminated
+		sc.ContainerStopped = &stopped
+	}
+
 	switch sc.Container.State {
 	case container.Running:
 		if sc.ContainerStarted.ProxyAddress == "" {
-			sc.ContainerStarted.ProxyAddress = a.address
+			if a.overlayAddress != "" {
+				sc.ContainerStarted.ProxyAddress = a.overlayAddress
+			} else {
+				sc.ContainerStarted.ProxyAddress = a.address
+			}
 		}
 	case container.Terminated:
 		delete(a.containers, sc.Container.ID)
@@ -167,6 +380,117 @@ func (a *agent) containerStateChanged(ctx *actor.Context, sc aproto.ContainerSta
 	ctx.Tell(task, rsc)
 	ctx.Tell(a.slots, rsc)
 	ctx.Tell(a.cluster, rsc)
+	// sproto.ContainerStateChanged carries no agent ref, so the cluster
+	// actor can't key its container->agent tracking off rsc alone; this
+	// carries the same transition with one, for cluster.shutdownContainers.
+	ctx.Tell(a.cluster, cluster.ContainerStateChanged{Agent: ctx.Self(), Container: sc.Container})
+}
+
+// hostOnly strips a trailing ":port" from addr, used to turn a websocket's
+// RemoteAddr or a v2 agent's dial address into the bare host ProxyAddress
+// falls back to when no overlay address is available.
+func hostOnly(addr string) string {
+	if i := strings.LastIndex(addr, ":"); i != -1 {
+		return addr[:i]
+	}
+	return addr
+}
+
+// joinMesh asks the mesh coordinator (a long-lived child of the cluster
+// actor, spawned in cluster.Cluster's PreStart) for this agent's overlay
+// address, keyed by nodeKey, and records both. It is a no-op if no
+// coordinator ref is available, leaving a.overlayAddress empty so
+// ProxyAddress falls back to a.address.
+func (a *agent) joinMesh(ctx *actor.Context, nodeKey mesh.NodeKey) {
+	meshRef, ok := ctx.Ask(a.cluster, cluster.GetMeshCoordinator{}).Get().(*actor.Ref)
+	if !ok || meshRef == nil {
+		return
+	}
+	a.mesh = meshRef
+	resp := ctx.Ask(a.mesh, mesh.Join{PeerID: ctx.Self().Address().Local(), NodeKey: nodeKey})
+	a.overlayAddress = resp.Get().(mesh.JoinResponse).OverlayAddress
+}
+
+// reconcileReattach is called when a reconnecting agent reports the
+// containers it still has running. It replays the state changes the master
+// missed while disconnected and cancels any container the agent no longer
+// knows about.
+func (a *agent) reconcileReattach(ctx *actor.Context, reattached aproto.AgentReattached) {
+	// This is the point where the reconnection is actually confirmed (the
+	// agent proved it's the same session by sending AgentReattached), so
+	// this is where the reconnect timer is disarmed and connectivity is
+	// reported, not on the bare websocket reconnect.
+	alerting.Emit(alerting.AgentConnected{AgentID: a.agentID, Labels: a.labels})
+	a.awaitingReconnect = false
+	if a.reconnectTimer != nil {
+		ctx.Tell(a.reconnectTimer, actor.StopSelf{})
+		a.reconnectTimer = nil
+	}
+
+	// reattached.Containers carries the same ContainerStarted/ContainerStopped
+	// info a live ContainerStateChanged would, not just the bare container
+	// ID/state: containerStateChanged guards against a RUNNING entry
+	// missing ContainerStarted by treating it as failed, so a malformed
+	// reattach can't nil-deref the agent actor.
+	stillRunning := stillRunningSet(reattached.Containers)
+	for _, sc := range reattached.Containers {
+		a.containerStateChanged(ctx, sc)
+	}
+
+	for cid, task := range a.containers {
+		if stillRunning[cid] {
+			continue
+		}
+		stopped := aproto.ContainerError(
+			aproto.AgentFailed, errors.New("container was lost while agent was disconnected"))
+		ctx.Tell(task, sproto.ContainerStateChanged{
+			Container:        container.Container{ID: cid, State: container.Terminated},
+			ContainerStopped: &stopped,
+		})
+		delete(a.containers, cid)
+	}
+}
+
+// stillRunningSet returns the set of container IDs reattached reports as
+// still running, split out of reconcileReattach so the diffing logic is
+// testable without an actor.Context.
+func stillRunningSet(containers []aproto.ContainerStateChanged) map[container.ID]bool {
+	stillRunning := make(map[container.ID]bool, len(containers))
+	for _, sc := range containers {
+		stillRunning[sc.Container.ID] = true
+	}
+	return stillRunning
+}
+
+// facts returns the merged label/constraint set a placement constraint
+// expression is evaluated against; labels take precedence since they are
+// operator-mutable overrides of the agent-reported constraint facts.
+func (a *agent) facts() constraint.Facts {
+	facts := make(constraint.Facts, len(a.labels)+len(a.constraints))
+	for k, v := range a.constraints {
+		facts[k] = v
+	}
+	for k, v := range a.labels {
+		facts[k] = v
+	}
+	return facts
+}
+
+// checkConstraint matches expr against a.facts() via constraint.Satisfies —
+// the same function a resource pool would call per candidate agent before
+// placement, so this recheck and real placement-time matching can't drift
+// into two independent implementations of what a constraint means.
+func (a *agent) checkConstraint(expr string) error {
+	ok, err := constraint.Satisfies(expr, a.facts())
+	if err != nil {
+		// Satisfies already wraps err with the expr that failed to parse;
+		// no need to wrap it again here.
+		return err
+	}
+	if !ok {
+		return errors.Errorf("agent no longer satisfies placement constraint %q", expr)
+	}
+	return nil
 }
 
 func (a *agent) summarize(ctx *actor.Context) agentSummary {
@@ -175,6 +499,7 @@ func (a *agent) summarize(ctx *actor.Context) agentSummary {
 		RegisteredTime: ctx.Self().RegisteredTime(),
 		Slots:          ctx.Ask(a.slots, slotsSummary{}).Get().(slotsSummary),
 		NumContainers:  len(a.containers),
-		Label:          a.label,
+		Labels:         a.labels,
+		Constraints:    a.constraints,
 	}
 }
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"github.com/determined-ai/determined/proto/pkg/agentv2"
+)
+
+// capability is a feature flag an agent can advertise during its handshake
+// (v1's extended AgentStarted or v2's Register RPC) so the master can
+// feature-gate new behavior per agent instead of requiring every agent in
+// the cluster to be upgraded in lockstep. Values mirror
+// agentv2.Capability.
+type capability string
+
+const (
+	capabilitySupportsReattach       capability = "SUPPORTS_REATTACH"
+	capabilitySupportsGPUTopology    capability = "SUPPORTS_GPU_TOPOLOGY"
+	capabilitySupportsLogCompression capability = "SUPPORTS_LOG_COMPRESSION"
+)
+
+// capabilitySet is the capabilities a connected agent actually has, after
+// negotiation with the master (the master never uses a capability the agent
+// didn't offer, even if the master supports it).
+type capabilitySet map[capability]bool
+
+func negotiateCapabilities(offered []string) capabilitySet {
+	supported := map[capability]bool{
+		capabilitySupportsReattach:       true,
+		capabilitySupportsGPUTopology:    true,
+		capabilitySupportsLogCompression: true,
+	}
+	negotiated := make(capabilitySet, len(offered))
+	for _, o := range offered {
+		if c := capability(o); supported[c] {
+			negotiated[c] = true
+		}
+	}
+	return negotiated
+}
+
+func (s capabilitySet) has(c capability) bool {
+	return s != nil && s[c]
+}
+
+// capabilityNames maps a v2 RegisterRequest's Capabilities to the string
+// form negotiateCapabilities expects, shared by newV2Adapter (building
+// AgentStarted.Capabilities) and Server.Register (deciding
+// RegisterResponse.AcceptedCapabilities) so both agree on what an agent
+// offered.
+func capabilityNames(cs []agentv2.Capability) []string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = capabilityName(c)
+	}
+	return names
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/determined-ai/determined/proto/pkg/agentv2"
+)
+
+func TestNegotiateCapabilities(t *testing.T) {
+	testCases := []struct {
+		name    string
+		offered []string
+		want    []capability
+	}{
+		{
+			name:    "all supported",
+			offered: []string{"SUPPORTS_REATTACH", "SUPPORTS_GPU_TOPOLOGY", "SUPPORTS_LOG_COMPRESSION"},
+			want: []capability{
+				capabilitySupportsReattach, capabilitySupportsGPUTopology, capabilitySupportsLogCompression,
+			},
+		},
+		{
+			name:    "unrecognized capability is dropped, not rejected",
+			offered: []string{"SUPPORTS_REATTACH", "SOME_FUTURE_CAPABILITY"},
+			want:    []capability{capabilitySupportsReattach},
+		},
+		{
+			name:    "none offered",
+			offered: nil,
+			want:    nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			negotiated := negotiateCapabilities(tc.offered)
+			if len(negotiated) != len(tc.want) {
+				t.Errorf("negotiateCapabilities(%v) = %v, want %v", tc.offered, negotiated, tc.want)
+			}
+			for _, c := range tc.want {
+				if !negotiated.has(c) {
+					t.Errorf("negotiateCapabilities(%v) missing %s", tc.offered, c)
+				}
+			}
+		})
+	}
+}
+
+// TestCapabilityName guards against the mismatch a reviewer previously
+// caught: protoc-gen-go's Capability.String() returns the enum value's full
+// name, including the CAPABILITY_ prefix, which negotiateCapabilities never
+// matches unless capabilityName strips it back off first.
+func TestCapabilityName(t *testing.T) {
+	testCases := []struct {
+		enum agentv2.Capability
+		want string
+	}{
+		{agentv2.Capability_CAPABILITY_SUPPORTS_REATTACH, "SUPPORTS_REATTACH"},
+		{agentv2.Capability_CAPABILITY_SUPPORTS_GPU_TOPOLOGY, "SUPPORTS_GPU_TOPOLOGY"},
+		{agentv2.Capability_CAPABILITY_SUPPORTS_LOG_COMPRESSION, "SUPPORTS_LOG_COMPRESSION"},
+	}
+	for _, tc := range testCases {
+		if got := capabilityName(tc.enum); got != tc.want {
+			t.Errorf("capabilityName(%v) = %q, want %q", tc.enum, got, tc.want)
+		}
+	}
+}
+
+func TestCapabilityNameRoundTripsThroughNegotiation(t *testing.T) {
+	offered := []string{capabilityName(agentv2.Capability_CAPABILITY_SUPPORTS_REATTACH)}
+	negotiated := negotiateCapabilities(offered)
+	if !negotiated.has(capabilitySupportsReattach) {
+		t.Fatal("a capability name produced by capabilityName must be one negotiateCapabilities recognizes")
+	}
+}
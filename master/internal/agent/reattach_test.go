@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"testing"
+
+	aproto "github.com/determined-ai/determined/master/pkg/agent"
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+func TestStillRunningSet(t *testing.T) {
+	containers := []aproto.ContainerStateChanged{
+		{Container: container.Container{ID: "c1", State: container.Running}},
+		{Container: container.Container{ID: "c2", State: container.Running}},
+	}
+
+	got := stillRunningSet(containers)
+
+	if len(got) != 2 {
+		t.Fatalf("stillRunningSet(%v) has %d entries, want 2", containers, len(got))
+	}
+	for _, id := range []container.ID{"c1", "c2"} {
+		if !got[id] {
+			t.Errorf("stillRunningSet(%v) missing %s", containers, id)
+		}
+	}
+	if got["c3"] {
+		t.Errorf("stillRunningSet(%v) reports c3 as still running, want false", containers)
+	}
+}
+
+func TestStillRunningSetEmpty(t *testing.T) {
+	got := stillRunningSet(nil)
+	if len(got) != 0 {
+		t.Fatalf("stillRunningSet(nil) = %v, want empty", got)
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/proto/pkg/agentv2"
+)
+
+// sessionTokenMetadataKey is the gRPC metadata key a v2 agent sends its
+// session token under on every RPC after Register. Register is the only
+// RPC whose request carries agent identity; StreamContainerEvents and
+// StreamLogs do not, so this is how Server ties them back to the agent
+// actor Register already resolved.
+const sessionTokenMetadataKey = "x-determined-session-token"
+
+// Server implements agentv2.AgentServiceServer, the gRPC counterpart of the
+// v1 HTTP handler that accepts a websocket upgrade and hands it to an agent
+// actor as ws.WebSocketConnected. Resolve is how Server finds or spawns the
+// agent actor a Register belongs to; this package does not own the
+// HTTP/gRPC bootstrap Server is mounted behind, so — the same way Cluster
+// takes its mesh CIDR and alerting config from outside instead of deciding
+// them itself — that policy is injected rather than hardcoded here.
+type Server struct {
+	agentv2.UnimplementedAgentServiceServer
+
+	Resolve func(req *agentv2.RegisterRequest) (*actor.Ref, error)
+
+	mu       sync.Mutex
+	sessions map[string]*pendingSession
+}
+
+// pendingSession is what Register resolves and StreamContainerEvents/
+// StreamLogs look back up by session token.
+type pendingSession struct {
+	agent *actor.Ref
+	req   *agentv2.RegisterRequest
+}
+
+// Register implements agentv2.AgentServiceServer. It resolves the agent
+// actor for req and stashes it under req.SessionToken for
+// StreamContainerEvents/StreamLogs — which the agent is expected to open
+// immediately afterward, sending sessionTokenMetadataKey — to pick up.
+func (s *Server) Register(
+	ctx context.Context, req *agentv2.RegisterRequest,
+) (*agentv2.RegisterResponse, error) {
+	agentRef, err := s.Resolve(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "resolving agent %q: %s", req.AgentId, err)
+	}
+
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*pendingSession)
+	}
+	s.sessions[req.SessionToken] = &pendingSession{agent: agentRef, req: req}
+	s.mu.Unlock()
+
+	return &agentv2.RegisterResponse{AcceptedCapabilities: acceptedCapabilities(req.Capabilities)}, nil
+}
+
+// StreamContainerEvents implements agentv2.AgentServiceServer. It looks up
+// the session Register stored, dials the agent back via newV2Adapter, and
+// runs the adapter's receive loop until the stream ends or errors; grpc-go
+// already invokes this method in its own goroutine per call, so there is
+// no separate "go run()" to write here.
+func (s *Server) StreamContainerEvents(stream agentv2.AgentService_StreamContainerEventsServer) error {
+	session, err := s.lookupSession(stream.Context())
+	if err != nil {
+		return err
+	}
+	adapter, err := newV2Adapter(session.agent, stream, session.req, session.req.ListenAddr)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "dialing agent back at %q: %s", session.req.ListenAddr, err)
+	}
+	return adapter.run()
+}
+
+// StreamLogs implements agentv2.AgentServiceServer. It expects the agent to
+// have already opened StreamContainerEvents for this session token — the
+// only call that resolves a RegisterRequest into an adapter — and returns
+// Unavailable rather than blocking if StreamLogs is opened first.
+func (s *Server) StreamLogs(stream agentv2.AgentService_StreamLogsServer) error {
+	session, err := s.lookupSession(stream.Context())
+	if err != nil {
+		return err
+	}
+	return (&v2Adapter{agent: session.agent}).runLogs(stream)
+}
+
+func (s *Server) lookupSession(ctx context.Context) (*pendingSession, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing session metadata")
+	}
+	tokens := md.Get(sessionTokenMetadataKey)
+	if len(tokens) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "missing %s metadata", sessionTokenMetadataKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[tokens[0]]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no Register call found for this session token")
+	}
+	return session, nil
+}
+
+// acceptedCapabilities filters offered down to what negotiateCapabilities
+// actually accepts, in enum form for RegisterResponse.
+func acceptedCapabilities(offered []agentv2.Capability) []agentv2.Capability {
+	negotiated := negotiateCapabilities(capabilityNames(offered))
+	accepted := make([]agentv2.Capability, 0, len(offered))
+	for _, c := range offered {
+		if negotiated.has(capability(capabilityName(c))) {
+			accepted = append(accepted, c)
+		}
+	}
+	return accepted
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/proto/pkg/agentv2"
+)
+
+func TestAcceptedCapabilitiesFiltersUnsupported(t *testing.T) {
+	offered := []agentv2.Capability{
+		agentv2.Capability_CAPABILITY_SUPPORTS_REATTACH,
+		agentv2.Capability_CAPABILITY_UNSPECIFIED,
+	}
+	accepted := acceptedCapabilities(offered)
+	if len(accepted) != 1 || accepted[0] != agentv2.Capability_CAPABILITY_SUPPORTS_REATTACH {
+		t.Fatalf("acceptedCapabilities(%v) = %v, want only SUPPORTS_REATTACH", offered, accepted)
+	}
+}
+
+func TestServerRegisterStoresSession(t *testing.T) {
+	agentRef := &actor.Ref{}
+	s := &Server{Resolve: func(req *agentv2.RegisterRequest) (*actor.Ref, error) {
+		return agentRef, nil
+	}}
+
+	req := &agentv2.RegisterRequest{AgentId: "a1", SessionToken: "tok"}
+	if _, err := s.Register(context.Background(), req); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+
+	ctx := metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs(sessionTokenMetadataKey, "tok"))
+	session, err := s.lookupSession(ctx)
+	if err != nil {
+		t.Fatalf("lookupSession returned error: %v", err)
+	}
+	if session.agent != agentRef {
+		t.Fatalf("lookupSession returned agent %v, want %v", session.agent, agentRef)
+	}
+}
+
+func TestServerLookupSessionErrors(t *testing.T) {
+	s := &Server{}
+
+	if _, err := s.lookupSession(context.Background()); err == nil {
+		t.Fatal("expected an error when no metadata is present")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	if _, err := s.lookupSession(ctx); err == nil {
+		t.Fatal("expected an error when the session token key is absent")
+	}
+
+	ctx = metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs(sessionTokenMetadataKey, "missing"))
+	if _, err := s.lookupSession(ctx); err == nil {
+		t.Fatal("expected an error for a session token with no matching Register call")
+	}
+}
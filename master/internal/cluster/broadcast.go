@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	ws "github.com/determined-ai/determined/master/pkg/actor/api"
+	aproto "github.com/determined-ai/determined/master/pkg/agent"
+)
+
+// BroadcastSignal is sent to the cluster actor to deliver the same
+// SignalContainer to every agent named in Targets. Unlike sending
+// aproto.SignalContainer to each agent individually, the payload is
+// marshaled exactly once into a websocket.PreparedMessage and the same
+// buffer is handed to every target's socket writer, avoiding repeated
+// marshaling on cluster-wide operations like preemption sweeps, graceful
+// shutdown, and priority-scheduler kills.
+type BroadcastSignal struct {
+	Targets []*actor.Ref
+	Signal  aproto.SignalContainer
+}
+
+// broadcastSignal marshals msg.Signal once and forwards the resulting
+// ws.WritePrepared to every target agent actor.
+func broadcastSignal(ctx *actor.Context, msg BroadcastSignal) error {
+	prepared, err := encodeSignal(msg.Signal)
+	if err != nil {
+		return err
+	}
+	write := ws.WritePrepared{Prepared: prepared}
+	for _, target := range msg.Targets {
+		ctx.Tell(target, write)
+	}
+	return nil
+}
+
+// encodeSignal marshals signal into the same wire-framed PreparedMessage a
+// v1 agent's websocket expects, split out of broadcastSignal so the
+// marshaling can be tested without an actor.Context.
+func encodeSignal(signal aproto.SignalContainer) (*websocket.PreparedMessage, error) {
+	payload, err := json.Marshal(aproto.AgentMessage{SignalContainer: &signal})
+	if err != nil {
+		return nil, err
+	}
+	return websocket.NewPreparedMessage(websocket.TextMessage, payload)
+}
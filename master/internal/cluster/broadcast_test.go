@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+
+	aproto "github.com/determined-ai/determined/master/pkg/agent"
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+func TestEncodeSignalSucceeds(t *testing.T) {
+	signal := aproto.SignalContainer{ContainerID: container.ID("c1"), Signal: aproto.SignalKill}
+	prepared, err := encodeSignal(signal)
+	if err != nil {
+		t.Fatalf("encodeSignal returned error: %v", err)
+	}
+	if prepared == nil {
+		t.Fatal("encodeSignal returned a nil PreparedMessage")
+	}
+}
+
+// TestEncodeSignalWrapsInAgentMessage guards against encodeSignal ever
+// marshaling a bare SignalContainer instead of wrapping it in an
+// AgentMessage, which is the envelope handleIncomingWSMessage on the agent
+// side expects every master-to-agent message to arrive in.
+func TestEncodeSignalWrapsInAgentMessage(t *testing.T) {
+	signal := aproto.SignalContainer{ContainerID: container.ID("c1"), Signal: aproto.SignalTerminate}
+
+	want, err := json.Marshal(aproto.AgentMessage{SignalContainer: &signal})
+	if err != nil {
+		t.Fatalf("json.Marshal(AgentMessage) returned error: %v", err)
+	}
+
+	var decoded aproto.AgentMessage
+	if err := json.Unmarshal(want, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %v", err)
+	}
+	if decoded.SignalContainer == nil {
+		t.Fatal("expected the marshaled payload to decode back into an AgentMessage with SignalContainer set")
+	}
+	if decoded.SignalContainer.ContainerID != signal.ContainerID || decoded.SignalContainer.Signal != signal.Signal {
+		t.Fatalf("decoded signal = %+v, want %+v", decoded.SignalContainer, signal)
+	}
+
+	if _, err := encodeSignal(signal); err != nil {
+		t.Fatalf("encodeSignal returned error: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package cluster hosts the cluster actor that tracks connected agents and
+// coordinates operations that span all of them.
+package cluster
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/determined-ai/determined/master/internal/mesh"
+	"github.com/determined-ai/determined/master/internal/sproto"
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/master/pkg/alerting"
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+// defaultMeshCIDR is the overlay range handed out to agents when the master
+// config does not override it.
+const defaultMeshCIDR = "100.64.0.0/10"
+
+// agentState is what Cluster tracks about a registered agent, keyed by its
+// actor ref.
+type agentState struct {
+	labels      map[string]string
+	constraints map[string]string
+
+	// protocolVersion is "v1" or "v2", reported separately from
+	// sproto.AddAgent via SetAgentProtocolVersion since which adapter an
+	// agent connected through is an agent-actor concern, not something the
+	// (external, unmodified-by-this-series) AddAgent message carries. It is
+	// empty until the agent actor reports it, which BroadcastSignal's
+	// target filtering treats the same as "v1" rather than excluding it.
+	protocolVersion string
+}
+
+// Cluster is the actor every agent actor reports to via sproto.AddAgent/
+// RemoveAgent/UpdateAgentLabels/ContainerStateChanged, and the parent of the
+// mesh coordinator that hands out overlay addresses.
+type Cluster struct {
+	// Alerting is the master config's alerting section; it is installed as
+	// the process-wide alerting pipeline in PreStart. The zero value is a
+	// valid, inert Config (no notifiers configured), so alerting is opt-in.
+	Alerting alerting.Config
+
+	// MeshCIDR is the master config's overlay address range for the mesh
+	// coordinator spawned in PreStart. Empty falls back to
+	// defaultMeshCIDR, the same way a zero-value Alerting falls back to an
+	// inert pipeline rather than requiring every master config to set it.
+	MeshCIDR string
+
+	mesh       *actor.Ref
+	agents     map[*actor.Ref]agentState
+	containers map[container.ID]map[*actor.Ref]bool
+}
+
+// GetMeshCoordinator returns the ref of the mesh coordinator actor spawned
+// in PreStart, so agent actors can Join/Leave the overlay without the
+// coordinator having to be threaded through agent construction by hand.
+type GetMeshCoordinator struct{}
+
+// SetAgentProtocolVersion is told to the cluster actor by an agent actor
+// once it knows which protocol version it is speaking ("v1" on
+// WebSocketConnected, "v2" on registerV2Adapter), so that fan-out
+// operations like BroadcastSignal can filter targets by protocol version
+// without touching the unrelated AddAgent message.
+type SetAgentProtocolVersion struct {
+	Agent           *actor.Ref
+	ProtocolVersion string
+}
+
+// Receive implements actor.Actor.
+func (c *Cluster) Receive(ctx *actor.Context) error {
+	switch msg := ctx.Message().(type) {
+	case actor.PreStart:
+		cidr := c.MeshCIDR
+		if cidr == "" {
+			cidr = defaultMeshCIDR
+		}
+		c.mesh, _ = ctx.ActorOf("mesh", mesh.NewCoordinator(cidr))
+		c.agents = make(map[*actor.Ref]agentState)
+		c.containers = make(map[container.ID]map[*actor.Ref]bool)
+		store, err := alerting.NewStore(c.Alerting)
+		if err != nil {
+			return errors.Wrap(err, "opening alerting store")
+		}
+		if err := alerting.Configure(c.Alerting, store); err != nil {
+			return errors.Wrap(err, "configuring alerting")
+		}
+	case GetMeshCoordinator:
+		ctx.Respond(c.mesh)
+	case sproto.AddAgent:
+		c.agents[msg.Agent] = agentState{labels: msg.Labels, constraints: msg.Constraints}
+	case sproto.RemoveAgent:
+		delete(c.agents, msg.Agent)
+	case sproto.UpdateAgentLabels:
+		state := c.agents[msg.Agent]
+		state.labels = msg.Labels
+		c.agents[msg.Agent] = state
+	case SetAgentProtocolVersion:
+		state := c.agents[msg.Agent]
+		state.protocolVersion = msg.ProtocolVersion
+		c.agents[msg.Agent] = state
+	case sproto.ContainerStateChanged:
+		// This case only exists so that containerStateChanged's
+		// unconditional ctx.Tell(a.cluster, rsc) doesn't hit the
+		// unexpected-message path below for every container transition in
+		// the cluster: sproto.ContainerStateChanged carries no agent ref
+		// for trackContainer to key on, so agent actors also send the
+		// cluster-owned ContainerStateChanged below alongside it.
+	case ContainerStateChanged:
+		c.trackContainer(msg)
+	case BroadcastSignal:
+		return broadcastSignal(ctx, c.filterV2Targets(msg))
+	case MatchingAgents:
+		matches, err := c.matchingAgents(msg.Selector)
+		if err != nil {
+			return err
+		}
+		ctx.Respond(matches)
+	case DrainAgents:
+		matches, err := c.matchingAgents(msg.Selector)
+		if err != nil {
+			return err
+		}
+		agentIDs := make([]string, 0, len(matches))
+		for _, ref := range matches {
+			ctx.Tell(ref, SetAgentEnabled{Enabled: msg.Enabled})
+			agentIDs = append(agentIDs, ref.Address().Local())
+		}
+		ctx.Respond(DrainAgentsResponse{AgentIDs: agentIDs})
+	case actor.PostStop:
+		c.shutdownContainers(ctx)
+	default:
+		return actor.ErrUnexpectedMessage(ctx)
+	}
+	return nil
+}
+
+// filterV2Targets drops any v2 agent from msg.Targets, logging what was
+// skipped. v2 agents are driven over typed unary RPCs, not the pre-encoded
+// websocket.PreparedMessage a BroadcastSignal carries, so they are never
+// valid targets; filtering here means a caller that built Targets from a
+// broader set (e.g. every agent matching a placement constraint, for a
+// cluster-wide preemption sweep) doesn't need to know about the distinction
+// itself.
+func (c *Cluster) filterV2Targets(msg BroadcastSignal) BroadcastSignal {
+	filtered := make([]*actor.Ref, 0, len(msg.Targets))
+	for _, target := range msg.Targets {
+		if c.agents[target].protocolVersion == "v2" {
+			logrus.Infof("skipping BroadcastSignal for v2 agent %s", target.Address().Local())
+			continue
+		}
+		filtered = append(filtered, target)
+	}
+	msg.Targets = filtered
+	return msg
+}
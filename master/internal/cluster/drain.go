@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/master/pkg/constraint"
+)
+
+// MatchingAgents is asked of the cluster actor to find every agent whose
+// merged labels/constraints satisfy Selector. This is the cluster-wide
+// placement query a scheduler uses to find candidate agents for a task,
+// as opposed to the agent actor's own checkConstraint, which only
+// re-validates a constraint against the single agent a task has already
+// been placed on.
+type MatchingAgents struct {
+	Selector string
+}
+
+// DrainAgents is the cluster-wide, selector-addressed counterpart of a
+// single EnableAgentRequest/DisableAgentRequest: it enables or disables
+// every agent whose merged labels/constraints satisfy Selector, so
+// operators can drain a whole rack/zone/GPU-generation by selector instead
+// of one agent ID at a time.
+type DrainAgents struct {
+	Selector string
+	Enabled  bool
+}
+
+// DrainAgentsResponse reports which agents DrainAgents actually matched.
+type DrainAgentsResponse struct {
+	AgentIDs []string
+}
+
+// SetAgentEnabled is told by DrainAgents to each agent actor it matched; it
+// has the same effect on that agent as EnableAgentRequest/
+// DisableAgentRequest.
+type SetAgentEnabled struct {
+	Enabled bool
+}
+
+func (c *Cluster) matchingAgents(selector string) ([]*actor.Ref, error) {
+	expr, err := constraint.Parse(selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid agent selector %q", selector)
+	}
+	var matches []*actor.Ref
+	for ref, state := range c.agents {
+		if expr.Match(state.facts()) {
+			matches = append(matches, ref)
+		}
+	}
+	return matches, nil
+}
+
+// facts merges an agentState's labels and constraints into the fact set a
+// constraint.Expr is evaluated against, mirroring agent.facts(); labels win
+// since they are operator-mutable overrides of agent-reported facts.
+func (s agentState) facts() constraint.Facts {
+	facts := make(constraint.Facts, len(s.labels)+len(s.constraints))
+	for k, v := range s.constraints {
+		facts[k] = v
+	}
+	for k, v := range s.labels {
+		facts[k] = v
+	}
+	return facts
+}
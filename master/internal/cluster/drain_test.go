@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+)
+
+func TestAgentStateFactsLabelsOverrideConstraints(t *testing.T) {
+	state := agentState{
+		constraints: map[string]string{"zone": "us-west-2a", "cuda": "11.4"},
+		labels:      map[string]string{"zone": "us-west-2b"},
+	}
+	facts := state.facts()
+	if facts["zone"] != "us-west-2b" {
+		t.Fatalf("facts[zone] = %q, want the operator-mutable label to win (us-west-2b)", facts["zone"])
+	}
+	if facts["cuda"] != "11.4" {
+		t.Fatalf("facts[cuda] = %q, want the agent-reported constraint to pass through", facts["cuda"])
+	}
+}
+
+func TestMatchingAgentsFiltersBySelector(t *testing.T) {
+	prod := &actor.Ref{}
+	dev := &actor.Ref{}
+	c := &Cluster{agents: map[*actor.Ref]agentState{
+		prod: {labels: map[string]string{"env": "prod"}},
+		dev:  {labels: map[string]string{"env": "dev"}},
+	}}
+
+	matches, err := c.matchingAgents("env==prod")
+	if err != nil {
+		t.Fatalf("matchingAgents returned error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != prod {
+		t.Fatalf("matchingAgents(env==prod) = %v, want just the prod agent", matches)
+	}
+}
+
+func TestMatchingAgentsInvalidSelector(t *testing.T) {
+	c := &Cluster{agents: map[*actor.Ref]agentState{}}
+	if _, err := c.matchingAgents("zone==prod&&"); err == nil {
+		t.Fatal("expected matchingAgents to reject a malformed selector")
+	}
+}
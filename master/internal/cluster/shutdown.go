@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	aproto "github.com/determined-ai/determined/master/pkg/agent"
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+// ContainerStateChanged is told to the cluster actor by an agent actor on
+// every container transition, alongside (and separately from) the
+// sproto.ContainerStateChanged it already sends: that message carries no
+// agent ref, since its other two recipients — the task actor and the slots
+// actor — are already scoped to a single agent and never needed one.
+// Cluster uses it only to track which agents are currently running which
+// container IDs, for shutdownContainers.
+type ContainerStateChanged struct {
+	Agent     *actor.Ref
+	Container container.Container
+}
+
+// trackContainer updates c.containers from msg, so shutdownContainers
+// knows which agents to broadcast a termination signal to for a given
+// container — typically more than one, for a distributed multi-node task.
+func (c *Cluster) trackContainer(msg ContainerStateChanged) {
+	switch msg.Container.State {
+	case container.Running:
+		if c.containers[msg.Container.ID] == nil {
+			c.containers[msg.Container.ID] = make(map[*actor.Ref]bool)
+		}
+		c.containers[msg.Container.ID][msg.Agent] = true
+	case container.Terminated:
+		delete(c.containers[msg.Container.ID], msg.Agent)
+		if len(c.containers[msg.Container.ID]) == 0 {
+			delete(c.containers, msg.Container.ID)
+		}
+	}
+}
+
+// shutdownContainers is called from Cluster's actor.PostStop — the real,
+// already-reachable "graceful shutdown" use case BroadcastSignal exists
+// for (see broadcast.go): it asks every agent currently reporting a
+// container as running to terminate it, one BroadcastSignal per container
+// ID rather than one SignalContainer write per (agent, replica) pair.
+// Errors are logged rather than aborting the sweep, since one container's
+// broadcast failing shouldn't stop the rest of the cluster shutting down
+// cleanly.
+func (c *Cluster) shutdownContainers(ctx *actor.Context) {
+	for id, agents := range c.containers {
+		targets := make([]*actor.Ref, 0, len(agents))
+		for ref := range agents {
+			targets = append(targets, ref)
+		}
+		msg := BroadcastSignal{
+			Targets: targets,
+			Signal:  aproto.SignalContainer{ContainerID: id, Signal: aproto.SignalTerminate},
+		}
+		if err := broadcastSignal(ctx, c.filterV2Targets(msg)); err != nil {
+			logrus.WithError(err).Errorf("broadcasting shutdown signal for container %s", id)
+		}
+	}
+}
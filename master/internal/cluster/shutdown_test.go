@@ -0,0 +1,39 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+func TestTrackContainerTracksMultipleAgentsPerContainer(t *testing.T) {
+	rank0 := &actor.Ref{}
+	rank1 := &actor.Ref{}
+	c := &Cluster{containers: map[container.ID]map[*actor.Ref]bool{}}
+
+	cid := container.ID("trial-1")
+	c.trackContainer(ContainerStateChanged{Agent: rank0, Container: container.Container{ID: cid, State: container.Running}})
+	c.trackContainer(ContainerStateChanged{Agent: rank1, Container: container.Container{ID: cid, State: container.Running}})
+
+	if len(c.containers[cid]) != 2 || !c.containers[cid][rank0] || !c.containers[cid][rank1] {
+		t.Fatalf("containers[%s] = %v, want both rank0 and rank1 tracked", cid, c.containers[cid])
+	}
+}
+
+func TestTrackContainerTerminatedClearsEntry(t *testing.T) {
+	agentRef := &actor.Ref{}
+	cid := container.ID("trial-1")
+	c := &Cluster{containers: map[container.ID]map[*actor.Ref]bool{
+		cid: {agentRef: true},
+	}}
+
+	c.trackContainer(ContainerStateChanged{
+		Agent:     agentRef,
+		Container: container.Container{ID: cid, State: container.Terminated},
+	})
+
+	if _, ok := c.containers[cid]; ok {
+		t.Fatalf("containers[%s] should have been removed once empty, got %v", cid, c.containers[cid])
+	}
+}
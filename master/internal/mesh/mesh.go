@@ -0,0 +1,137 @@
+// Package mesh coordinates an overlay network joining the master and every
+// connected agent, so that ProxyAddress values handed out for containers are
+// dialable by any peer regardless of the underlay topology (NAT, separate
+// VPCs, Kubernetes overlay networks unreachable from the master).
+//
+// The coordinator itself only tracks which overlay IP belongs to which peer
+// and their WireGuard/tailnet node keys; establishing the actual encrypted
+// tunnels is delegated to the mesh client running alongside each agent.
+package mesh
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/determined-ai/determined/master/pkg/actor"
+	"github.com/determined-ai/determined/master/pkg/check"
+)
+
+// NodeKey is a peer's public key in the overlay mesh (e.g. a WireGuard
+// public key), used to authenticate and address it.
+type NodeKey string
+
+// Join is sent by an agent actor once it has a node key to report, normally
+// on ws.WebSocketConnected. The coordinator assigns (or returns the
+// existing) overlay IP for that peer.
+type Join struct {
+	PeerID  string
+	NodeKey NodeKey
+}
+
+// JoinResponse is the reply to Join.
+type JoinResponse struct {
+	OverlayAddress string
+}
+
+// Leave is sent when a peer disconnects so its overlay IP can be reclaimed.
+type Leave struct {
+	PeerID string
+}
+
+// Coordinator is the actor maintaining the overlay mesh's membership: which
+// peers are in the mesh, their node keys, and their assigned overlay
+// addresses. It is a singleton child of the cluster actor.
+type Coordinator struct {
+	cidr    *net.IPNet
+	next    uint32
+	free    []string
+	members map[string]member
+}
+
+type member struct {
+	nodeKey        NodeKey
+	overlayAddress string
+}
+
+// NewCoordinator creates a mesh Coordinator handing out addresses from
+// cidr, e.g. "100.64.0.0/10" in tailnet-style deployments. cidr must be a
+// valid IPv4 CIDR; this is a master config invariant, checked at startup
+// rather than plumbed through as a runtime error.
+func NewCoordinator(cidr string) *Coordinator {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	check.Panic(check.True(err == nil, "invalid mesh CIDR %q", cidr))
+	check.Panic(check.True(ipNet.IP.To4() != nil, "mesh CIDR %q must be IPv4", cidr))
+	return &Coordinator{cidr: ipNet, members: make(map[string]member)}
+}
+
+// Receive implements actor.Actor.
+func (c *Coordinator) Receive(ctx *actor.Context) error {
+	switch msg := ctx.Message().(type) {
+	case actor.PreStart:
+		c.members = make(map[string]member)
+	case Join:
+		m, ok := c.members[msg.PeerID]
+		if !ok || m.nodeKey != msg.NodeKey {
+			if ok {
+				c.release(m.overlayAddress)
+			}
+			addr, err := c.allocate()
+			if err != nil {
+				return err
+			}
+			m = member{nodeKey: msg.NodeKey, overlayAddress: addr}
+			c.members[msg.PeerID] = m
+		}
+		ctx.Respond(JoinResponse{OverlayAddress: m.overlayAddress})
+	case Leave:
+		if m, ok := c.members[msg.PeerID]; ok {
+			c.release(m.overlayAddress)
+			delete(c.members, msg.PeerID)
+		}
+	default:
+		return actor.ErrUnexpectedMessage(ctx)
+	}
+	return nil
+}
+
+// allocate returns the next free address within c.cidr, preferring one
+// reclaimed by a prior release over extending the high-water mark, so a
+// peer that rejoins after a true Leave gets its address back instead of
+// the coordinator chewing through the range on churn.
+func (c *Coordinator) allocate() (string, error) {
+	if n := len(c.free); n > 0 {
+		addr := c.free[n-1]
+		c.free = c.free[:n-1]
+		return addr, nil
+	}
+	ip, ok := c.nthAddress(c.next + 1)
+	if !ok {
+		return "", errors.Errorf("mesh overlay range %s is exhausted", c.cidr)
+	}
+	c.next++
+	return ip.String(), nil
+}
+
+// release returns addr to the free list so a future allocate reuses it.
+func (c *Coordinator) release(addr string) {
+	c.free = append(c.free, addr)
+}
+
+// nthAddress derives the address n past the network address of c.cidr,
+// reporting false once it reaches the broadcast address or falls outside
+// the range entirely, so allocate never hands out either of those as if
+// they were a usable host address.
+func (c *Coordinator) nthAddress(n uint32) (net.IP, bool) {
+	base := binary.BigEndian.Uint32(c.cidr.IP.To4())
+	mask := binary.BigEndian.Uint32(c.cidr.Mask)
+	broadcast := base | ^mask
+	candidate := base + n
+	if candidate >= broadcast {
+		return nil, false
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, candidate)
+	return ip, true
+}
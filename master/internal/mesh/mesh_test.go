@@ -0,0 +1,68 @@
+package mesh
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAllocateRespectsCIDR(t *testing.T) {
+	c := NewCoordinator("10.1.2.0/24")
+	for i := 0; i < 10; i++ {
+		addr, err := c.allocate()
+		if err != nil {
+			t.Fatalf("allocate() #%d returned error: %v", i, err)
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil || !c.cidr.Contains(ip) {
+			t.Fatalf("allocate() #%d returned %s, want an address inside %s", i, addr, c.cidr)
+		}
+	}
+}
+
+func TestAllocateExhaustion(t *testing.T) {
+	// A /30 has exactly two usable host addresses between its network
+	// address (.0) and its broadcast address (.3): .1 and .2. A third
+	// allocate must fail rather than silently wrapping into the next
+	// network or handing out the broadcast address.
+	c := NewCoordinator("10.1.2.0/30")
+	for i := 0; i < 2; i++ {
+		if _, err := c.allocate(); err != nil {
+			t.Fatalf("allocate() #%d returned error: %v", i, err)
+		}
+	}
+	if _, err := c.allocate(); err == nil {
+		t.Fatal("expected allocate() to fail once the range is exhausted")
+	}
+}
+
+func TestReleaseReusesAddress(t *testing.T) {
+	c := NewCoordinator("10.1.2.0/24")
+	addr, err := c.allocate()
+	if err != nil {
+		t.Fatalf("allocate() returned error: %v", err)
+	}
+	c.release(addr)
+
+	reused, err := c.allocate()
+	if err != nil {
+		t.Fatalf("allocate() after release returned error: %v", err)
+	}
+	if reused != addr {
+		t.Fatalf("allocate() after release = %s, want the released address %s", reused, addr)
+	}
+}
+
+func TestAllocateDoesNotReuseBeforeRelease(t *testing.T) {
+	c := NewCoordinator("10.1.2.0/24")
+	first, err := c.allocate()
+	if err != nil {
+		t.Fatalf("allocate() returned error: %v", err)
+	}
+	second, err := c.allocate()
+	if err != nil {
+		t.Fatalf("allocate() returned error: %v", err)
+	}
+	if first == second {
+		t.Fatalf("allocate() returned %s twice without a release in between", first)
+	}
+}
@@ -0,0 +1,13 @@
+package api
+
+import "github.com/gorilla/websocket"
+
+// WritePrepared tells a websocket actor to write an already-encoded frame
+// directly to its connection via (*websocket.Conn).WritePreparedMessage,
+// instead of marshaling Message the way WriteMessage does. Cluster-wide
+// broadcasts (preemption sweeps, graceful shutdown, priority-scheduler
+// kills) use this so the identical payload is encoded once and handed to
+// every agent's socket writer, rather than re-marshaled per agent.
+type WritePrepared struct {
+	Prepared *websocket.PreparedMessage
+}
@@ -0,0 +1,145 @@
+// Package agent defines the wire-level messages exchanged between the
+// master and an agent once a connection has been established, whether over
+// the v1 websocket framing or the v2 gRPC adapter. Both transports
+// translate into these same types before reaching the agent actor's
+// Receive loop, so the actor itself never branches on protocol version.
+package agent
+
+import (
+	"time"
+
+	"github.com/determined-ai/determined/master/pkg/container"
+)
+
+// MasterMessage is a message traveling from an agent to the master. Exactly
+// one field is set.
+type MasterMessage struct {
+	AgentStarted          *AgentStarted
+	AgentReattached       *AgentReattached
+	ContainerStateChanged *ContainerStateChanged
+	ContainerLog          *ContainerLog
+}
+
+// AgentMessage is a message traveling from the master to an agent. Exactly
+// one field is set.
+type AgentMessage struct {
+	StartContainer  *StartContainer
+	SignalContainer *SignalContainer
+}
+
+// Device describes a single piece of compute hardware (typically a GPU)
+// reported by an agent on AgentStarted, used for telemetry and scheduling.
+type Device struct {
+	ID    int
+	Brand string
+	UUID  string
+}
+
+// AgentStarted is sent once, immediately after an agent establishes its
+// connection, identifying it and reporting its capabilities and resources.
+type AgentStarted struct {
+	// AgentID and SessionToken identify the physical agent independent of
+	// its transport or actor address, so a reconnecting agent can be
+	// recognized as the same agent rather than a new one.
+	AgentID      string
+	SessionToken string
+	Capabilities []string
+
+	// ReconnectTimeout overrides how long the master keeps this agent's
+	// actor and in-flight containers alive across a dropped connection
+	// before treating it as failed; zero lets the master fall back to its
+	// own default.
+	ReconnectTimeout time.Duration
+
+	Labels      map[string]string
+	Constraints map[string]string
+	Devices     []Device
+}
+
+// AgentReattached is sent by a reconnecting agent instead of AgentStarted
+// when its AgentID and SessionToken match a still-live agent actor,
+// enumerating the containers it is still running so the master can
+// reconcile them against what it believes is running.
+type AgentReattached struct {
+	Containers []ContainerStateChanged
+}
+
+// ContainerStateChanged reports a container's lifecycle transition.
+type ContainerStateChanged struct {
+	Container        container.Container
+	ContainerStarted *ContainerStarted
+	ContainerStopped *ContainerStopped
+}
+
+// ContainerStarted carries the information only known once a container is
+// actually running.
+type ContainerStarted struct {
+	ProxyAddress string
+}
+
+// FailureType classifies why a container stopped running unexpectedly.
+type FailureType string
+
+const (
+	// AgentFailed indicates the container stopped because its agent did.
+	AgentFailed FailureType = "AGENT_FAILED"
+
+	// ConstraintViolation indicates the container was never started (or
+	// was stopped) because the agent no longer satisfies its placement
+	// constraint; unlike AgentFailed this reflects a single task being
+	// rejected, not the agent itself failing.
+	ConstraintViolation FailureType = "CONSTRAINT_VIOLATION"
+)
+
+// ContainerStopped describes how and why a container exited.
+type ContainerStopped struct {
+	Failure *FailureType
+	Err     string
+}
+
+// ContainerError builds a ContainerStopped recording a failure.
+func ContainerError(failureType FailureType, err error) ContainerStopped {
+	return ContainerStopped{Failure: &failureType, Err: err.Error()}
+}
+
+// ContainerLog is a single line of log output produced by a container.
+type ContainerLog struct {
+	Container   container.Container
+	Timestamp   time.Time
+	PullMessage *string
+	RunMessage  *string
+	AuxMessage  *string
+}
+
+// StartContainer tells an agent to start running a container from Spec.
+type StartContainer struct {
+	Spec []byte
+}
+
+// Signal is a lifecycle signal the master can send to a running container.
+type Signal int
+
+const (
+	// SignalKill forcibly kills the container.
+	SignalKill Signal = iota
+	// SignalTerminate asks the container to exit gracefully.
+	SignalTerminate
+)
+
+// String implements fmt.Stringer.
+func (s Signal) String() string {
+	switch s {
+	case SignalKill:
+		return "KILL"
+	case SignalTerminate:
+		return "TERMINATE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// SignalContainer tells an agent to send Signal to ContainerID.
+type SignalContainer struct {
+	ContainerID container.ID
+	Signal      Signal
+}
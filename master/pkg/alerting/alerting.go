@@ -0,0 +1,140 @@
+// Package alerting consumes agent connectivity events and dispatches them to
+// pluggable notifier backends (webhook, Slack, PagerDuty, email) once a
+// condition's debounce, minimum-consecutive-count, and label filters are
+// satisfied. Condition state is persisted through a Store so that a master
+// restart does not cause duplicate notifications for an already-flapping
+// agent.
+package alerting
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Store persists per-agent, per-condition counters across master restarts.
+type Store interface {
+	Load(condition, agentID string) (record, bool)
+	Save(condition, agentID string, r record)
+}
+
+// Subsystem is the running alerting pipeline: a set of conditions, each
+// wired to a notifier, fed by Emit.
+type Subsystem struct {
+	store      Store
+	conditions map[string][]Condition
+
+	mu sync.Mutex
+}
+
+// New creates a Subsystem that checks incoming events against conditions,
+// keyed by Event.Condition().
+func New(store Store, conditions map[string][]Condition) *Subsystem {
+	return &Subsystem{store: store, conditions: conditions}
+}
+
+var current *Subsystem
+
+// SetDefault installs s as the process-wide alerting pipeline used by Emit.
+// It is called once during master startup.
+func SetDefault(s *Subsystem) { current = s }
+
+// Emit hands ev to the process-wide alerting pipeline, if one has been
+// installed with SetDefault. Call sites (e.g. the agent actor) call this
+// unconditionally; when no pipeline is configured it is a no-op so that
+// alerting stays optional.
+func Emit(ev Event) {
+	if current == nil {
+		return
+	}
+	current.handle(ev)
+}
+
+// flapConditions are the conditions a successful reconnect clears, so that
+// MinConsecutive measures consecutive occurrences since the agent was last
+// seen healthy rather than a lifetime count. Without this, an agent that
+// flapped once long ago and has been stable ever since would alert on its
+// very next disconnect.
+var flapConditions = []string{AgentDisconnected{}.Condition(), AgentDegraded{}.Condition()}
+
+func (s *Subsystem) handle(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agentID := agentIDOf(ev)
+	if _, ok := ev.(AgentConnected); ok {
+		for _, condition := range flapConditions {
+			s.store.Save(condition, agentID, record{})
+		}
+	}
+
+	labels := labelsOf(ev)
+	for _, cond := range s.conditions[ev.Condition()] {
+		if !matchesSelector(cond.LabelSelector, labels) {
+			continue
+		}
+		s.evaluate(ev, agentID, cond)
+	}
+}
+
+// matchesSelector reports whether labels contains every key/value pair in
+// selector; an empty or nil selector matches everything.
+func matchesSelector(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subsystem) evaluate(ev Event, agentID string, cond Condition) {
+	r, _ := s.store.Load(ev.Condition(), agentID)
+	r.Condition, r.AgentID = ev.Condition(), agentID
+	r.Count++
+	r.LastEmitted = time.Now()
+	defer func() { s.store.Save(ev.Condition(), agentID, r) }()
+
+	if r.Count < cond.MinConsecutive {
+		return
+	}
+	if cond.Debounce > 0 && !r.LastNotify.IsZero() &&
+		time.Now().Sub(r.LastNotify).Seconds() < float64(cond.Debounce) {
+		return
+	}
+
+	if err := cond.Notifier.Notify(context.Background(), ev); err != nil {
+		logrus.WithError(err).Errorf(
+			"alerting: %s notifier failed for condition %s", cond.Notifier.Name(), ev.Condition())
+		return
+	}
+	r.LastNotify = time.Now()
+}
+
+func agentIDOf(ev Event) string {
+	switch e := ev.(type) {
+	case AgentConnected:
+		return e.AgentID
+	case AgentDisconnected:
+		return e.AgentID
+	case AgentDegraded:
+		return e.AgentID
+	default:
+		return ""
+	}
+}
+
+func labelsOf(ev Event) map[string]string {
+	switch e := ev.(type) {
+	case AgentConnected:
+		return e.Labels
+	case AgentDisconnected:
+		return e.Labels
+	case AgentDegraded:
+		return e.Labels
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	records map[string]record
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{records: make(map[string]record)}
+}
+
+func (f *fakeStore) key(condition, agentID string) string { return condition + "/" + agentID }
+
+func (f *fakeStore) Load(condition, agentID string) (record, bool) {
+	r, ok := f.records[f.key(condition, agentID)]
+	return r, ok
+}
+
+func (f *fakeStore) Save(condition, agentID string, r record) {
+	f.records[f.key(condition, agentID)] = r
+}
+
+type fakeNotifier struct {
+	notifications int
+	err           error
+}
+
+func (f *fakeNotifier) Name() string { return "fake" }
+
+func (f *fakeNotifier) Notify(_ context.Context, _ Event) error {
+	f.notifications++
+	return f.err
+}
+
+func TestEvaluateMinConsecutive(t *testing.T) {
+	notifier := &fakeNotifier{}
+	s := &Subsystem{store: newFakeStore()}
+	cond := Condition{Notifier: notifier, MinConsecutive: 3}
+	ev := AgentDisconnected{AgentID: "agent-1"}
+
+	for i := 0; i < 2; i++ {
+		s.evaluate(ev, "agent-1", cond)
+	}
+	if notifier.notifications != 0 {
+		t.Fatalf("expected no notification before MinConsecutive is reached, got %d", notifier.notifications)
+	}
+
+	s.evaluate(ev, "agent-1", cond)
+	if notifier.notifications != 1 {
+		t.Fatalf("expected a notification once MinConsecutive is reached, got %d", notifier.notifications)
+	}
+}
+
+func TestEvaluateDebounce(t *testing.T) {
+	notifier := &fakeNotifier{}
+	store := newFakeStore()
+	s := &Subsystem{store: store}
+	cond := Condition{Notifier: notifier, Debounce: 60}
+	ev := AgentDisconnected{AgentID: "agent-1"}
+
+	s.evaluate(ev, "agent-1", cond)
+	if notifier.notifications != 1 {
+		t.Fatalf("expected the first occurrence to notify, got %d", notifier.notifications)
+	}
+
+	s.evaluate(ev, "agent-1", cond)
+	if notifier.notifications != 1 {
+		t.Fatalf("expected the debounce window to suppress a second notification, got %d", notifier.notifications)
+	}
+
+	r, _ := store.Load(ev.Condition(), "agent-1")
+	r.LastNotify = time.Now().Add(-time.Minute)
+	store.Save(ev.Condition(), "agent-1", r)
+
+	s.evaluate(ev, "agent-1", cond)
+	if notifier.notifications != 2 {
+		t.Fatalf("expected a notification once the debounce window elapsed, got %d", notifier.notifications)
+	}
+}
+
+func TestEvaluateNotifierErrorDoesNotAdvanceLastNotify(t *testing.T) {
+	notifier := &fakeNotifier{err: context.DeadlineExceeded}
+	store := newFakeStore()
+	s := &Subsystem{store: store}
+	cond := Condition{Notifier: notifier}
+	ev := AgentDegraded{AgentID: "agent-1"}
+
+	s.evaluate(ev, "agent-1", cond)
+
+	r, ok := store.Load(ev.Condition(), "agent-1")
+	if !ok {
+		t.Fatal("expected a record to be saved even when the notifier fails")
+	}
+	if !r.LastNotify.IsZero() {
+		t.Fatal("expected LastNotify to stay zero when the notifier returned an error")
+	}
+}
+
+func TestHandleResetsFlapConditionsOnReconnect(t *testing.T) {
+	notifier := &fakeNotifier{}
+	store := newFakeStore()
+	s := New(store, map[string][]Condition{
+		AgentDisconnected{}.Condition(): {{Notifier: notifier, MinConsecutive: 2}},
+	})
+
+	s.handle(AgentDisconnected{AgentID: "agent-1"})
+	r, _ := store.Load(AgentDisconnected{}.Condition(), "agent-1")
+	if r.Count != 1 {
+		t.Fatalf("expected one recorded disconnect, got %d", r.Count)
+	}
+
+	s.handle(AgentConnected{AgentID: "agent-1"})
+	r, _ = store.Load(AgentDisconnected{}.Condition(), "agent-1")
+	if r.Count != 0 {
+		t.Fatalf("expected AgentConnected to reset the flap counter, got count %d", r.Count)
+	}
+}
+
+func TestHandleLabelSelector(t *testing.T) {
+	notifier := &fakeNotifier{}
+	store := newFakeStore()
+	s := New(store, map[string][]Condition{
+		AgentDisconnected{}.Condition(): {
+			{Notifier: notifier, LabelSelector: map[string]string{"env": "prod"}},
+		},
+	})
+
+	s.handle(AgentDisconnected{AgentID: "agent-1", Labels: map[string]string{"env": "dev"}})
+	if notifier.notifications != 0 {
+		t.Fatalf("expected the selector to filter out a non-matching agent, got %d notifications", notifier.notifications)
+	}
+
+	s.handle(AgentDisconnected{AgentID: "agent-2", Labels: map[string]string{"env": "prod", "zone": "us-west-2a"}})
+	if notifier.notifications != 1 {
+		t.Fatalf("expected the selector to match an agent whose labels are a superset, got %d notifications", notifier.notifications)
+	}
+}
@@ -0,0 +1,108 @@
+package alerting
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the master-config surface for the alerting subsystem: which
+// notifier backends are available and which conditions route events to
+// them. It is read once at master startup, where Configure installs the
+// resulting Subsystem with SetDefault.
+type Config struct {
+	Notifiers  map[string]NotifierConfig `json:"notifiers"`
+	Conditions []ConditionConfig         `json:"conditions"`
+
+	// StorePath, if set, persists condition state (MinConsecutive/Debounce
+	// counters) to a FileStore at this path so a master restart does not
+	// cause duplicate notifications for an already-flapping agent. Empty
+	// keeps the previous behavior of an in-process MemStore, which resets
+	// on every restart.
+	StorePath string `json:"store_path,omitempty"`
+}
+
+// NotifierConfig configures a single notifier backend, keyed by name in
+// Config.Notifiers and referenced by that name from ConditionConfig.
+type NotifierConfig struct {
+	// Type selects the backend: "webhook", "slack", or "pagerduty". Email
+	// is not configurable here since it requires an SMTP sender injected
+	// by the caller; construct an EmailNotifier directly and add it to a
+	// Subsystem's conditions in code instead.
+	Type string `json:"type"`
+
+	URL        string `json:"url,omitempty"`         // webhook
+	WebhookURL string `json:"webhook_url,omitempty"` // slack
+	RoutingKey string `json:"routing_key,omitempty"` // pagerduty
+}
+
+// ConditionConfig configures when events matching Condition are dispatched
+// to Notifier, e.g. only alert on agent_disconnected for prod agents after
+// 3 consecutive disconnects with at most one notification per 10 minutes.
+type ConditionConfig struct {
+	Condition      string            `json:"condition"`
+	Notifier       string            `json:"notifier"`
+	Debounce       int64             `json:"debounce_seconds"`
+	MinConsecutive int               `json:"min_consecutive"`
+	LabelSelector  map[string]string `json:"label_selector"`
+}
+
+// NewStore builds the Store cfg selects: a FileStore at cfg.StorePath if
+// set, so condition state survives a master restart, or a MemStore
+// otherwise.
+func NewStore(cfg Config) (Store, error) {
+	if cfg.StorePath == "" {
+		return NewMemStore(), nil
+	}
+	store, err := NewFileStore(cfg.StorePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening alerting store %q", cfg.StorePath)
+	}
+	return store, nil
+}
+
+// Configure builds a Subsystem from cfg and store and installs it with
+// SetDefault, so Emit starts dispatching according to the master config.
+// It is called once during master startup; an empty Config is valid and
+// leaves alerting installed but inert, since no condition matches any
+// event until one is configured.
+func Configure(cfg Config, store Store) error {
+	notifiers := make(map[string]Notifier, len(cfg.Notifiers))
+	for name, nc := range cfg.Notifiers {
+		notifier, err := buildNotifier(nc)
+		if err != nil {
+			return errors.Wrapf(err, "configuring notifier %q", name)
+		}
+		notifiers[name] = notifier
+	}
+
+	conditions := make(map[string][]Condition, len(cfg.Conditions))
+	for _, cc := range cfg.Conditions {
+		notifier, ok := notifiers[cc.Notifier]
+		if !ok {
+			return errors.Errorf("condition %q references unknown notifier %q", cc.Condition, cc.Notifier)
+		}
+		conditions[cc.Condition] = append(conditions[cc.Condition], Condition{
+			Notifier:       notifier,
+			Debounce:       cc.Debounce,
+			MinConsecutive: cc.MinConsecutive,
+			LabelSelector:  cc.LabelSelector,
+		})
+	}
+
+	SetDefault(New(store, conditions))
+	return nil
+}
+
+func buildNotifier(nc NotifierConfig) (Notifier, error) {
+	switch nc.Type {
+	case "webhook":
+		return &WebhookNotifier{URL: nc.URL, Client: http.DefaultClient}, nil
+	case "slack":
+		return &SlackNotifier{WebhookURL: nc.WebhookURL, Client: http.DefaultClient}, nil
+	case "pagerduty":
+		return &PagerDutyNotifier{RoutingKey: nc.RoutingKey, Client: http.DefaultClient}, nil
+	default:
+		return nil, errors.Errorf("unknown notifier type %q", nc.Type)
+	}
+}
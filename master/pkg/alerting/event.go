@@ -0,0 +1,52 @@
+package alerting
+
+import "time"
+
+// Event is something that happened to an agent that operators may want to be
+// notified about. The concrete types below are emitted by the agent actor.
+type Event interface {
+	// Condition identifies the kind of event for debounce and filtering
+	// purposes, e.g. "agent_disconnected".
+	Condition() string
+}
+
+// AgentConnected is emitted when an agent establishes (or re-establishes)
+// its websocket connection to the master.
+type AgentConnected struct {
+	AgentID string
+	Labels  map[string]string
+}
+
+// Condition implements Event.
+func (AgentConnected) Condition() string { return "agent_connected" }
+
+// AgentDisconnected is emitted when an agent's websocket connection drops,
+// whether or not it later reattaches within the reconnection window.
+type AgentDisconnected struct {
+	AgentID string
+	Labels  map[string]string
+}
+
+// Condition implements Event.
+func (AgentDisconnected) Condition() string { return "agent_disconnected" }
+
+// AgentDegraded is emitted when an agent's actor tree reports a failure that
+// is not an ordinary disconnect, e.g. a child actor (socket or slots) crashed.
+type AgentDegraded struct {
+	AgentID string
+	Labels  map[string]string
+	Reason  string
+}
+
+// Condition implements Event.
+func (AgentDegraded) Condition() string { return "agent_degraded" }
+
+// record is the persisted view of an event used to drive debounce and
+// consecutive-count conditions across master restarts.
+type record struct {
+	Condition   string
+	AgentID     string
+	Count       int
+	LastEmitted time.Time
+	LastNotify  time.Time
+}
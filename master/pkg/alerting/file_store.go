@@ -0,0 +1,74 @@
+package alerting
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// FileStore is a Store backed by a JSON file on disk, so that
+// MinConsecutive/Debounce condition state survives a master restart instead
+// of resetting to zero the way MemStore does. It is not safe for use by
+// more than one master process against the same path.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]record
+}
+
+// NewFileStore loads path, if it exists, into a FileStore that persists
+// every subsequent Save back to it. A missing file is treated as an empty
+// store rather than an error, so the first master startup against a fresh
+// path doesn't need to pre-create it.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, records: make(map[string]record)}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "reading alerting store %q", path)
+	case len(data) == 0:
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return nil, errors.Wrapf(err, "parsing alerting store %q", path)
+	}
+	return s, nil
+}
+
+func (s *FileStore) key(condition, agentID string) string { return condition + "/" + agentID }
+
+// Load implements Store.
+func (s *FileStore) Load(condition, agentID string) (record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[s.key(condition, agentID)]
+	return r, ok
+}
+
+// Save implements Store. A failure to persist to disk is logged rather than
+// returned, matching Store's interface (Load/Save do not return errors);
+// the in-memory counter is still updated, so a single write failure only
+// risks losing that one update across a restart, not the current session's
+// debounce/consecutive-count behavior.
+func (s *FileStore) Save(condition, agentID string, r record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.key(condition, agentID)] = r
+	if err := s.persist(); err != nil {
+		logrus.WithError(err).Errorf("alerting: persisting store to %q", s.path)
+	}
+}
+
+func (s *FileStore) persist() error {
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
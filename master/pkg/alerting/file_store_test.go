@@ -0,0 +1,86 @@
+package alerting
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerting.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore returned error: %v", err)
+	}
+
+	if _, ok := s.Load("agent_disconnected", "agent-1"); ok {
+		t.Fatal("expected no record in a freshly created store")
+	}
+
+	want := record{Condition: "agent_disconnected", AgentID: "agent-1", Count: 3, LastNotify: time.Now()}
+	s.Save("agent_disconnected", "agent-1", want)
+
+	got, ok := s.Load("agent_disconnected", "agent-1")
+	if !ok {
+		t.Fatal("expected Load to find the record just Saved")
+	}
+	if got.Count != want.Count {
+		t.Fatalf("Load returned Count = %d, want %d", got.Count, want.Count)
+	}
+}
+
+// TestFileStorePersistsAcrossRestarts guards against the scenario StorePath
+// exists to fix: a master restart resetting MinConsecutive/Debounce
+// counters and re-notifying an already-flapping agent.
+func TestFileStorePersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerting.json")
+
+	first, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore returned error: %v", err)
+	}
+	first.Save("agent_disconnected", "agent-1", record{Count: 5})
+
+	second, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore returned error on reopen: %v", err)
+	}
+	got, ok := second.Load("agent_disconnected", "agent-1")
+	if !ok {
+		t.Fatal("expected a FileStore reopened at the same path to find the prior record")
+	}
+	if got.Count != 5 {
+		t.Fatalf("reopened FileStore returned Count = %d, want 5", got.Count)
+	}
+}
+
+func TestFileStoreMissingFileIsEmptyNotError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore returned error for a missing file: %v", err)
+	}
+	if _, ok := s.Load("agent_disconnected", "agent-1"); ok {
+		t.Fatal("expected no record when the backing file doesn't exist yet")
+	}
+}
+
+func TestNewStoreSelectsByStorePath(t *testing.T) {
+	if _, ok := mustNewStore(t, Config{}).(*MemStore); !ok {
+		t.Fatal("expected NewStore to return a MemStore when StorePath is empty")
+	}
+
+	path := filepath.Join(t.TempDir(), "alerting.json")
+	if _, ok := mustNewStore(t, Config{StorePath: path}).(*FileStore); !ok {
+		t.Fatal("expected NewStore to return a FileStore when StorePath is set")
+	}
+}
+
+func mustNewStore(t *testing.T, cfg Config) Store {
+	t.Helper()
+	store, err := NewStore(cfg)
+	if err != nil {
+		t.Fatalf("NewStore returned error: %v", err)
+	}
+	return store
+}
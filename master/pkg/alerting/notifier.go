@@ -0,0 +1,33 @@
+package alerting
+
+import "context"
+
+// Notifier dispatches an event to an operator-facing channel once a
+// condition's filters (debounce, minimum consecutive count, label selector)
+// have been satisfied.
+type Notifier interface {
+	// Name identifies the notifier in configuration and logs, e.g. "webhook".
+	Name() string
+	// Notify delivers ev. It should return an error only for delivery
+	// failures the caller should retry or log; it must not block
+	// indefinitely.
+	Notify(ctx context.Context, ev Event) error
+}
+
+// Condition configures when a stream of events for a single Condition()
+// value should be turned into a notification.
+type Condition struct {
+	// Notifier is the backend this condition dispatches to when triggered.
+	Notifier Notifier
+	// Debounce suppresses repeat notifications for the same agent within
+	// this interval.
+	Debounce int64 // seconds; stored as int64 to keep the config serializable.
+	// MinConsecutive is how many times the condition must fire in a row for
+	// the same agent before a notification is sent, e.g. to ignore a single
+	// blip.
+	MinConsecutive int
+	// LabelSelector, if non-empty, restricts this condition to agents whose
+	// labels are a superset of it, e.g. {"env": "prod"} only matches agents
+	// with a label key "env" set to exactly "prod".
+	LabelSelector map[string]string
+}
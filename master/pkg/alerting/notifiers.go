@@ -0,0 +1,172 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkResponse closes resp.Body and returns an error if the endpoint
+// reported a non-2xx status, so a rejected delivery isn't mistaken for a
+// successful one.
+func checkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("notifier request failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookNotifier POSTs a JSON-encoded event to a configured URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name implements Notifier.
+func (w *WebhookNotifier) Name() string { return "webhook" }
+
+// Notify implements Notifier.
+func (w *WebhookNotifier) Notify(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp)
+}
+
+// SlackNotifier posts a simple text message to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Name implements Notifier.
+func (s *SlackNotifier) Name() string { return "slack" }
+
+// Notify implements Notifier.
+func (s *SlackNotifier) Notify(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(map[string]string{"text": formatMessage(ev)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, s.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp)
+}
+
+// PagerDutyNotifier triggers a PagerDuty Events API v2 incident.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Client     *http.Client
+}
+
+// Name implements Notifier.
+func (p *PagerDutyNotifier) Name() string { return "pagerduty" }
+
+// Notify implements Notifier.
+func (p *PagerDutyNotifier) Notify(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]string{
+			"summary":  formatMessage(ev),
+			"source":   "determined-master",
+			"severity": "warning",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://events.pagerduty.com/v2/enqueue", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp)
+}
+
+// EmailNotifier sends a notification through an already-configured SMTP
+// sender. send is injected so this package does not own SMTP credentials.
+type EmailNotifier struct {
+	To   []string
+	send func(to []string, subject, body string) error
+}
+
+// NewEmailNotifier builds an EmailNotifier that delivers through send.
+func NewEmailNotifier(to []string, send func(to []string, subject, body string) error) *EmailNotifier {
+	return &EmailNotifier{To: to, send: send}
+}
+
+// Name implements Notifier.
+func (e *EmailNotifier) Name() string { return "email" }
+
+// Notify implements Notifier.
+func (e *EmailNotifier) Notify(_ context.Context, ev Event) error {
+	return e.send(e.To, "Determined agent alert: "+ev.Condition(), formatMessage(ev))
+}
+
+func formatMessage(ev Event) string {
+	switch e := ev.(type) {
+	case AgentConnected:
+		return "agent " + e.AgentID + " (labels=" + formatLabels(e.Labels) + ") connected"
+	case AgentDisconnected:
+		return "agent " + e.AgentID + " (labels=" + formatLabels(e.Labels) + ") disconnected"
+	case AgentDegraded:
+		return "agent " + e.AgentID + " (labels=" + formatLabels(e.Labels) + ") degraded: " + e.Reason
+	default:
+		return ev.Condition()
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + labels[k]
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,34 @@
+package alerting
+
+import "sync"
+
+// MemStore is an in-process Store holding no state across master restarts;
+// MinConsecutive/Debounce windows restart from zero on every master
+// restart. It is the Store NewStore falls back to when the config does not
+// set StorePath; see FileStore for one that persists across restarts.
+type MemStore struct {
+	mu      sync.Mutex
+	records map[string]record
+}
+
+// NewMemStore creates an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{records: make(map[string]record)}
+}
+
+func (s *MemStore) key(condition, agentID string) string { return condition + "/" + agentID }
+
+// Load implements Store.
+func (s *MemStore) Load(condition, agentID string) (record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[s.key(condition, agentID)]
+	return r, ok
+}
+
+// Save implements Store.
+func (s *MemStore) Save(condition, agentID string, r record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.key(condition, agentID)] = r
+}
@@ -0,0 +1,164 @@
+// Package constraint parses and evaluates the placement constraint
+// expressions experiments and tasks can attach to a resource request, e.g.
+//
+//	cuda.version>=11.4 && zone in (us-west-2a,us-west-2b) && !spot
+//
+// against an agent's reported labels and constraints (kernel version, CUDA
+// version, hostname, availability zone, custom operator tags, ...).
+package constraint
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Facts is the set of key/value facts a constraint expression is evaluated
+// against: an agent's merged labels and constraints.
+type Facts map[string]string
+
+// Expr is a parsed constraint expression that can be matched against a set
+// of Facts.
+type Expr struct {
+	clauses []clause
+}
+
+type clause struct {
+	key    string
+	negate bool
+	op     string // "", "==", "!=", ">=", "<=", ">", "<", "in"
+	values []string
+}
+
+// Parse parses a "&&"-separated constraint expression. Each clause is one
+// of: `key`, `!key` (boolean presence/absence), `key OP value` for
+// OP in {==, !=, >=, <=, >, <} (numeric if both sides parse as numbers,
+// lexicographic otherwise), or `key in (v1,v2,...)`.
+func Parse(expr string) (*Expr, error) {
+	if strings.TrimSpace(expr) == "" {
+		return &Expr{}, nil
+	}
+	var clauses []clause
+	for _, raw := range strings.Split(expr, "&&") {
+		c, err := parseClause(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid constraint clause %q", raw)
+		}
+		clauses = append(clauses, c)
+	}
+	return &Expr{clauses: clauses}, nil
+}
+
+func parseClause(raw string) (clause, error) {
+	switch {
+	case raw == "":
+		return clause{}, errors.New("empty clause")
+	case strings.Contains(raw, " in "):
+		parts := strings.SplitN(raw, " in ", 2)
+		key := strings.TrimSpace(parts[0])
+		list := strings.Trim(strings.TrimSpace(parts[1]), "()")
+		var values []string
+		for _, v := range strings.Split(list, ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return clause{key: key, op: "in", values: values}, nil
+	case strings.HasPrefix(raw, "!"):
+		return clause{key: strings.TrimSpace(raw[1:]), negate: true}, nil
+	default:
+		for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+			if idx := strings.Index(raw, op); idx != -1 {
+				key := strings.TrimSpace(raw[:idx])
+				value := strings.TrimSpace(raw[idx+len(op):])
+				return clause{key: key, op: op, values: []string{value}}, nil
+			}
+		}
+		return clause{key: raw}, nil
+	}
+}
+
+// Satisfies parses expr and reports whether facts satisfies it. It is the
+// single implementation shared by every single-agent constraint check in
+// this series — the agent actor's post-placement recheck and, were a
+// resource pool to call it, a pre-placement candidate test too — so expr
+// parsing and matching aren't reimplemented independently at each call
+// site. Callers that need to test many agents against one expr (e.g.
+// Cluster.matchingAgents) should call Parse once and reuse the *Expr
+// instead, since Satisfies parses expr on every call.
+func Satisfies(expr string, facts Facts) (bool, error) {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid constraint %q", expr)
+	}
+	return parsed.Match(facts), nil
+}
+
+// Match reports whether every clause in e is satisfied by facts.
+func (e *Expr) Match(facts Facts) bool {
+	for _, c := range e.clauses {
+		if !c.match(facts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c clause) match(facts Facts) bool {
+	_, present := facts[c.key]
+	if c.op == "" {
+		return present != c.negate
+	}
+
+	actual, ok := facts[c.key]
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "in":
+		for _, v := range c.values {
+			if v == actual {
+				return true
+			}
+		}
+		return false
+	default:
+		return compare(actual, c.op, c.values[0])
+	}
+}
+
+func compare(actual, op, want string) bool {
+	actualNum, errA := strconv.ParseFloat(actual, 64)
+	wantNum, errB := strconv.ParseFloat(want, 64)
+	if errA == nil && errB == nil {
+		switch op {
+		case "==":
+			return actualNum == wantNum
+		case "!=":
+			return actualNum != wantNum
+		case ">=":
+			return actualNum >= wantNum
+		case "<=":
+			return actualNum <= wantNum
+		case ">":
+			return actualNum > wantNum
+		case "<":
+			return actualNum < wantNum
+		}
+	}
+	switch op {
+	case "==":
+		return actual == want
+	case "!=":
+		return actual != want
+	case ">=":
+		return actual >= want
+	case "<=":
+		return actual <= want
+	case ">":
+		return actual > want
+	case "<":
+		return actual < want
+	default:
+		return false
+	}
+}
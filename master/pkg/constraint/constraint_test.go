@@ -0,0 +1,125 @@
+package constraint
+
+import "testing"
+
+func TestParseAndMatch(t *testing.T) {
+	testCases := []struct {
+		name  string
+		expr  string
+		facts Facts
+		want  bool
+	}{
+		{
+			name:  "empty expression matches anything",
+			expr:  "",
+			facts: Facts{},
+			want:  true,
+		},
+		{
+			name:  "boolean presence",
+			expr:  "spot",
+			facts: Facts{"spot": "true"},
+			want:  true,
+		},
+		{
+			name:  "boolean presence missing",
+			expr:  "spot",
+			facts: Facts{},
+			want:  false,
+		},
+		{
+			name:  "boolean negation",
+			expr:  "!spot",
+			facts: Facts{},
+			want:  true,
+		},
+		{
+			name:  "boolean negation present",
+			expr:  "!spot",
+			facts: Facts{"spot": "true"},
+			want:  false,
+		},
+		{
+			name:  "numeric comparison",
+			expr:  "cuda.version>=11.4",
+			facts: Facts{"cuda.version": "11.8"},
+			want:  true,
+		},
+		{
+			name:  "numeric comparison fails",
+			expr:  "cuda.version>=11.4",
+			facts: Facts{"cuda.version": "11.2"},
+			want:  false,
+		},
+		{
+			name:  "lexicographic comparison when not numeric",
+			expr:  "zone==us-west-2a",
+			facts: Facts{"zone": "us-west-2a"},
+			want:  true,
+		},
+		{
+			name:  "in clause",
+			expr:  "zone in (us-west-2a,us-west-2b)",
+			facts: Facts{"zone": "us-west-2b"},
+			want:  true,
+		},
+		{
+			name:  "in clause no match",
+			expr:  "zone in (us-west-2a,us-west-2b)",
+			facts: Facts{"zone": "us-east-1a"},
+			want:  false,
+		},
+		{
+			name:  "conjunction requires every clause",
+			expr:  "cuda.version>=11.4 && zone in (us-west-2a,us-west-2b) && !spot",
+			facts: Facts{"cuda.version": "11.8", "zone": "us-west-2a"},
+			want:  true,
+		},
+		{
+			name:  "conjunction fails on one clause",
+			expr:  "cuda.version>=11.4 && zone in (us-west-2a,us-west-2b) && !spot",
+			facts: Facts{"cuda.version": "11.8", "zone": "us-west-2a", "spot": "true"},
+			want:  false,
+		},
+		{
+			name:  "missing fact fails a comparison clause",
+			expr:  "cuda.version>=11.4",
+			facts: Facts{},
+			want:  false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tc.expr, err)
+			}
+			if got := expr.Match(tc.facts); got != tc.want {
+				t.Errorf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	expr := "cuda.version>=11.4 && "
+	if _, err := Parse(expr); err == nil {
+		t.Errorf("Parse(%q) expected an error for an empty clause", expr)
+	}
+}
+
+func TestSatisfiesMatchesParseAndMatch(t *testing.T) {
+	ok, err := Satisfies("zone==us-west-2a", Facts{"zone": "us-west-2a"})
+	if err != nil {
+		t.Fatalf("Satisfies returned error: %v", err)
+	}
+	if !ok {
+		t.Error("Satisfies(zone==us-west-2a) = false, want true")
+	}
+}
+
+func TestSatisfiesInvalidExpr(t *testing.T) {
+	if _, err := Satisfies("zone==us-west-2a && ", Facts{}); err == nil {
+		t.Error("Satisfies expected an error for an empty clause")
+	}
+}
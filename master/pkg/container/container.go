@@ -0,0 +1,32 @@
+// Package container defines the identifiers and lifecycle states the
+// master and an agent share when tracking a single container.
+package container
+
+// ID uniquely identifies a container within an agent, assigned by the
+// master when it dispatches a task to that agent.
+type ID string
+
+// State is a container's place in its lifecycle, as tracked by the master.
+type State string
+
+const (
+	// Running means the container's task process is running on its agent.
+	Running State = "RUNNING"
+
+	// Terminated means the container has permanently exited; the master
+	// has no further expectation of ContainerStateChanged events for it.
+	Terminated State = "TERMINATED"
+
+	// Disconnected means the agent running the container is unreachable
+	// but still within its reconnection window: the container may well
+	// still be running, and the master withholds judgement until the
+	// agent reattaches (transitioning the container back to its prior
+	// state) or the window expires (transitioning it to Terminated).
+	Disconnected State = "DISCONNECTED"
+)
+
+// Container is a single container's identity and last-known state.
+type Container struct {
+	ID    ID
+	State State
+}